@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/etsangsplk/vault_exporter/pkg/collector"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the top-level --config.file document. It follows the
+// blackbox_exporter/snmp_exporter convention of a flat map of named
+// modules, each describing how to reach and authenticate to one class of
+// probe target.
+type Config struct {
+	Modules map[string]Module `yaml:"modules"`
+}
+
+// Module describes one named probe configuration.
+type Module struct {
+	Auth moduleAuth `yaml:"auth"`
+	TLS  moduleTLS  `yaml:"tls_config"`
+}
+
+// moduleAuth is the YAML-friendly mirror of collector.AuthConfig; probe.go
+// converts it before handing it to collector.NewVaultCollector.
+type moduleAuth struct {
+	Method       string `yaml:"method"`
+	Token        string `yaml:"token"`
+	RoleID       string `yaml:"role_id"`
+	SecretID     string `yaml:"secret_id"`
+	K8sRole      string `yaml:"kubernetes_role"`
+	K8sTokenPath string `yaml:"kubernetes_token_path"`
+	AWSRole      string `yaml:"aws_role"`
+}
+
+func (m moduleAuth) authConfig() collector.AuthConfig {
+	return collector.AuthConfig{
+		Method:       m.Method,
+		Token:        m.Token,
+		RoleID:       m.RoleID,
+		SecretID:     m.SecretID,
+		K8sRole:      m.K8sRole,
+		K8sTokenPath: m.K8sTokenPath,
+		AWSRole:      m.AWSRole,
+	}
+}
+
+// moduleTLS is the YAML-friendly mirror of collector.TLSConfig.
+type moduleTLS struct {
+	CACert     string `yaml:"ca_cert"`
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+	Insecure   bool   `yaml:"insecure_skip_verify"`
+}
+
+func (t moduleTLS) tlsConfig() collector.TLSConfig {
+	return collector.TLSConfig{
+		CACert:     t.CACert,
+		ClientCert: t.ClientCert,
+		ClientKey:  t.ClientKey,
+		Insecure:   t.Insecure,
+	}
+}
+
+// safeConfig guards a Config behind a mutex so /probe requests can read it
+// while set replaces it. main sets it once at startup; the file is not
+// reloaded afterwards.
+type safeConfig struct {
+	mu  sync.RWMutex
+	cfg *Config
+}
+
+func (sc *safeConfig) get() *Config {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.cfg
+}
+
+func (sc *safeConfig) set(cfg *Config) {
+	sc.mu.Lock()
+	sc.cfg = cfg
+	sc.mu.Unlock()
+}
+
+// loadConfig reads and parses a --config.file document.
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %v", err)
+	}
+	return cfg, nil
+}
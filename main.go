@@ -3,163 +3,135 @@ package main
 import (
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 
-	vault_api "github.com/hashicorp/vault/api"
+	"github.com/etsangsplk/vault_exporter/pkg/collector"
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/promlog"
+	promlogflag "github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
+	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
-const (
-	namespace = "vault"
-)
-
-var (
-	up = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"Was the last query of Vault successful.",
-		nil, nil,
-	)
-	initialized = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "initialized"),
-		"Is the Vault initialised (according to this node).",
-		nil, nil,
-	)
-	sealed = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "sealed"),
-		"Is the Vault node sealed.",
-		nil, nil,
-	)
-	standby = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "standby"),
-		"Is this Vault node in standby.",
-		nil, nil,
-	)
-	ver = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "version"),
-		"Version of this Vault node.",
-		[]string{"version"}, nil,
-	)
-	clusterName = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "cluster_name"),
-		"Cluster name according to this Vault node.",
-		[]string{"cluster_name"}, nil,
-	)
-	clusterID = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "cluster_id"),
-		"Cluster ID according to this Vault node.",
-		[]string{"cluster_id"}, nil,
-	)
-)
-
-// Exporter collects Vault health from the given server and exports them using
-// the Prometheus metrics package.
-type Exporter struct {
-	client *vault_api.Client
-}
-
-// NewExporter returns an initialized Exporter.
-func NewExporter() (*Exporter, error) {
-	client, err := vault_api.NewClient(vault_api.DefaultConfig())
-	if err != nil {
-		return nil, err
-	}
-
-	return &Exporter{
-		client: client,
-	}, nil
-}
-
-// Describe describes all the metrics ever exported by the Vault exporter. It
-// implements prometheus.Collector.
-func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- up
-	ch <- initialized
-	ch <- sealed
-	ch <- standby
-	ch <- ver
-	ch <- clusterName
-	ch <- clusterID
-}
-
-func bool2float(b bool) float64 {
-	if b {
-		return 1
-	}
-	return 0
-}
-
-// Collect fetches the stats from configured Vault and delivers them
-// as Prometheus metrics. It implements prometheus.Collector.
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	health, err := e.client.Sys().Health()
-	if err != nil {
-		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0,
-		)
-		log.Errorf("Failted to collect health from Vault server: %v", err)
-		return
-	}
-
-	ch <- prometheus.MustNewConstMetric(
-		up, prometheus.GaugeValue, 1,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		initialized, prometheus.GaugeValue, bool2float(health.Initialized),
-	)
-	ch <- prometheus.MustNewConstMetric(
-		sealed, prometheus.GaugeValue, bool2float(health.Sealed),
-	)
-	ch <- prometheus.MustNewConstMetric(
-		standby, prometheus.GaugeValue, bool2float(health.Standby),
-	)
-	ch <- prometheus.MustNewConstMetric(
-		ver, prometheus.GaugeValue, 1, health.Version,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		clusterName, prometheus.GaugeValue, 1, health.ClusterName,
-	)
-	ch <- prometheus.MustNewConstMetric(
-		clusterID, prometheus.GaugeValue, 1, health.ClusterID,
-	)
-}
-
 func init() {
 	prometheus.MustRegister(version.NewCollector("vault_exporter"))
 }
 
 func main() {
 	var (
-		listenAddress = kingpin.Flag("web.listen-address",
-			"Address to listen on for web interface and telemetry.").
-			Default(":9107").String()
+		webConfig   = webflag.AddFlags(kingpin.CommandLine, ":9107")
 		metricsPath = kingpin.Flag("web.telemetry-path",
 			"Path under which to expose metrics.").
 			Default("/metrics").String()
+		authMethod = kingpin.Flag("vault.auth-method",
+			"Vault auth method to use to log in: token, approle, kubernetes, aws-iam.").
+			Default("token").Envar("VAULT_AUTH_METHOD").String()
+		vaultToken = kingpin.Flag("vault.token",
+			"Vault token to use with --vault.auth-method=token.").
+			Envar("VAULT_TOKEN").String()
+		approleRoleID = kingpin.Flag("vault.approle-role-id",
+			"AppRole role_id to use with --vault.auth-method=approle.").
+			Envar("VAULT_ROLE_ID").String()
+		approleSecretID = kingpin.Flag("vault.approle-secret-id",
+			"AppRole secret_id to use with --vault.auth-method=approle.").
+			Envar("VAULT_SECRET_ID").String()
+		k8sRole = kingpin.Flag("vault.kubernetes-role",
+			"Vault role to use with --vault.auth-method=kubernetes.").
+			Envar("VAULT_K8S_ROLE").String()
+		k8sTokenPath = kingpin.Flag("vault.kubernetes-token-path",
+			"Path to the Kubernetes service account token to present with --vault.auth-method=kubernetes.").
+			Default("/var/run/secrets/kubernetes.io/serviceaccount/token").
+			Envar("VAULT_K8S_TOKEN_PATH").String()
+		awsRole = kingpin.Flag("vault.aws-role",
+			"Vault role to use with --vault.auth-method=aws-iam.").
+			Envar("VAULT_AWS_ROLE").String()
+		collectLeader = kingpin.Flag("collector.leader",
+			"Collect leader/HA status (calls sys/leader).").
+			Default("true").Bool()
+		collectRaft = kingpin.Flag("collector.raft",
+			"Collect Raft autopilot peer health (requires sys/storage/raft/autopilot/state capability).").
+			Default("true").Bool()
+		metricsFormat = kingpin.Flag("vault.metrics-format",
+			"Format to request Vault's own sys/metrics telemetry in: prometheus or json.").
+			Default("prometheus").Enum("prometheus", "json")
+		configFile = kingpin.Flag("config.file",
+			"Path to a module configuration file used by /probe (blackbox_exporter style). "+
+				"If unset, a single \"default\" module is built from the --vault.* flags above.").
+			String()
 	)
-	log.AddFlags(kingpin.CommandLine)
+	promlogConfig := &promlog.Config{}
+	promlogflag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.Version(version.Print("vault_exporter"))
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
-	log.Infoln("Starting vault_exporter", version.Info())
-	log.Infoln("Build context", version.BuildContext())
+	logger := promlog.New(promlogConfig)
+
+	level.Info(logger).Log("msg", "Starting vault_exporter", "version", version.Info())
+	level.Info(logger).Log("msg", "Build context", "context", version.BuildContext())
 
-	exporter, err := NewExporter()
+	authCfg := collector.AuthConfig{
+		Method:       *authMethod,
+		Token:        *vaultToken,
+		RoleID:       *approleRoleID,
+		SecretID:     *approleSecretID,
+		K8sRole:      *k8sRole,
+		K8sTokenPath: *k8sTokenPath,
+		AWSRole:      *awsRole,
+	}
+
+	vc, err := collector.NewVaultCollector(collector.Config{
+		Auth:          authCfg,
+		CollectLeader: *collectLeader,
+		CollectRaft:   *collectRaft,
+		Logger:        logger,
+	})
 	if err != nil {
-		log.Fatalln(err)
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+	prometheus.MustRegister(vc)
+	prometheus.MustRegister(collector.NewTelemetryCollector(vc.Client(), *metricsFormat, logger))
+
+	sc := &safeConfig{}
+	if *configFile != "" {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "error loading --config.file", "err", err)
+			os.Exit(1)
+		}
+		sc.set(cfg)
+	} else {
+		sc.set(&Config{
+			Modules: map[string]Module{
+				"default": {
+					Auth: moduleAuth{
+						Method:       authCfg.Method,
+						Token:        authCfg.Token,
+						RoleID:       authCfg.RoleID,
+						SecretID:     authCfg.SecretID,
+						K8sRole:      authCfg.K8sRole,
+						K8sTokenPath: authCfg.K8sTokenPath,
+						AWSRole:      authCfg.AWSRole,
+					},
+				},
+			},
+		})
 	}
-	prometheus.MustRegister(exporter)
 
 	http.Handle(*metricsPath, promhttp.Handler())
+	http.Handle("/probe", newProbeHandler(sc, *collectLeader, *collectRaft, *metricsFormat, logger))
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html>
              <head><title>Vault Exporter</title></head>
              <body>
              <h1>Vault Exporter</h1>
              <p><a href='` + *metricsPath + `'>Metrics</a></p>
+             <p><a href='/probe?target=https://vault:8200&module=default'>Example probe</a></p>
              <h2>Build</h2>
              <pre>` + version.Info() + ` ` + version.BuildContext() + `</pre>
              </body>
@@ -169,6 +141,9 @@ func main() {
 		}
 	})
 
-	log.Infoln("Listening on", *listenAddress)
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	srv := &http.Server{}
+	if err := web.ListenAndServe(srv, webConfig, logger); err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
 }
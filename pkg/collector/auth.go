@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	vault_api "github.com/hashicorp/vault/api"
+)
+
+// login authenticates to Vault using the configured method and returns the
+// resulting client token along with its lease duration. For the "token"
+// method no network call is made and the lease duration is zero, since the
+// caller is expected to manage that token's lifecycle itself.
+func login(client *vault_api.Client, cfg AuthConfig) (string, time.Duration, error) {
+	switch cfg.Method {
+	case "token":
+		if cfg.Token == "" {
+			return "", 0, fmt.Errorf("--vault.auth-method=token requires --vault.token or VAULT_TOKEN to be set")
+		}
+		return cfg.Token, 0, nil
+
+	case "approle":
+		secret, err := client.Logical().Write("auth/approle/login", map[string]interface{}{
+			"role_id":   cfg.RoleID,
+			"secret_id": cfg.SecretID,
+		})
+		if err != nil {
+			return "", 0, fmt.Errorf("approle login: %v", err)
+		}
+		return tokenFromSecret(secret)
+
+	case "kubernetes":
+		jwt, err := ioutil.ReadFile(cfg.K8sTokenPath)
+		if err != nil {
+			return "", 0, fmt.Errorf("reading kubernetes service account token from %s: %v", cfg.K8sTokenPath, err)
+		}
+		secret, err := client.Logical().Write("auth/kubernetes/login", map[string]interface{}{
+			"role": cfg.K8sRole,
+			"jwt":  string(jwt),
+		})
+		if err != nil {
+			return "", 0, fmt.Errorf("kubernetes login: %v", err)
+		}
+		return tokenFromSecret(secret)
+
+	case "aws-iam":
+		loginData, err := awsIAMLoginData(cfg.AWSRole)
+		if err != nil {
+			return "", 0, fmt.Errorf("building aws-iam login data: %v", err)
+		}
+		secret, err := client.Logical().Write("auth/aws/login", loginData)
+		if err != nil {
+			return "", 0, fmt.Errorf("aws-iam login: %v", err)
+		}
+		return tokenFromSecret(secret)
+
+	default:
+		return "", 0, fmt.Errorf("unknown auth method %q", cfg.Method)
+	}
+}
+
+// tokenFromSecret extracts the client token and lease duration from a
+// Vault auth response.
+func tokenFromSecret(secret *vault_api.Secret) (string, time.Duration, error) {
+	if secret == nil || secret.Auth == nil {
+		return "", 0, fmt.Errorf("login returned no auth information")
+	}
+	return secret.Auth.ClientToken, time.Duration(secret.Auth.LeaseDuration) * time.Second, nil
+}
+
+// awsIAMLoginData builds the request Vault's aws-iam auth method expects,
+// by pre-signing an sts:GetCallerIdentity call with the ambient AWS
+// credentials (environment, shared config, or instance/task role) and
+// handing Vault the signed request to verify.
+func awsIAMLoginData(role string) (map[string]interface{}, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("creating aws session: %v", err)
+	}
+
+	req, _ := sts.New(sess).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	if err := req.Sign(); err != nil {
+		return nil, fmt.Errorf("signing sts:GetCallerIdentity request: %v", err)
+	}
+
+	headers, err := json.Marshal(req.HTTPRequest.Header)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if req.HTTPRequest.Body != nil {
+		body, err = ioutil.ReadAll(req.HTTPRequest.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := map[string]interface{}{
+		"iam_http_request_method": req.HTTPRequest.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.HTTPRequest.URL.String())),
+		"iam_request_body":        base64.StdEncoding.EncodeToString(body),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}
+	if role != "" {
+		data["role"] = role
+	}
+	return data, nil
+}
@@ -0,0 +1,423 @@
+// Package collector implements a prometheus.Collector for Vault, built
+// around the same authenticated *vault_api.Client used to scrape Vault's
+// own telemetry endpoint.
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	vault_api "github.com/hashicorp/vault/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minRenewInterval is the floor we sleep for between renewal attempts, so a
+// Vault bug returning a near-zero lease duration can't spin us into a busy
+// loop of RenewSelf calls.
+const minRenewInterval = 10 * time.Second
+
+const namespace = "vault"
+
+var (
+	up = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Was the last query of Vault successful.",
+		nil, nil,
+	)
+	initialized = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "initialized"),
+		"Is the Vault initialised (according to this node).",
+		nil, nil,
+	)
+	sealed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "sealed"),
+		"Is the Vault node sealed.",
+		nil, nil,
+	)
+	standby = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "standby"),
+		"Is this Vault node in standby.",
+		nil, nil,
+	)
+	ver = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "version"),
+		"Version of this Vault node.",
+		[]string{"version"}, nil,
+	)
+	clusterName = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "cluster_name"),
+		"Cluster name according to this Vault node.",
+		[]string{"cluster_name"}, nil,
+	)
+	clusterID = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "cluster_id"),
+		"Cluster ID according to this Vault node.",
+		[]string{"cluster_id"}, nil,
+	)
+	replicationDRSecondary = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "replication_dr_secondary"),
+		"Is this Vault node a DR replication secondary.",
+		nil, nil,
+	)
+	sealThreshold = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "seal_threshold"),
+		"Number of key shares required to unseal this Vault node.",
+		nil, nil,
+	)
+	sealProgress = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "seal_progress"),
+		"Number of key shares already provided towards unsealing this Vault node.",
+		nil, nil,
+	)
+	leaderIsSelf = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "leader_is_self"),
+		"Is this Vault node the cluster leader.",
+		nil, nil,
+	)
+	haEnabled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "ha_enabled"),
+		"Is this Vault node running in HA mode.",
+		nil, nil,
+	)
+	raftPeers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_peers"),
+		"Number of peers in the Raft cluster, according to Raft autopilot.",
+		nil, nil,
+	)
+	raftPeerHealthy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_peer_healthy"),
+		"Is the given Raft peer healthy, according to Raft autopilot.",
+		[]string{"peer_id", "address"}, nil,
+	)
+	raftLastIndexGap = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "raft_last_index_gap"),
+		"Difference between the Raft leader's last log index and this peer's, according to Raft autopilot.",
+		[]string{"peer_id", "address"}, nil,
+	)
+)
+
+// AuthConfig holds the method-specific settings needed to log in to Vault.
+// Only the fields relevant to Method are used.
+type AuthConfig struct {
+	Method string
+
+	// approle
+	RoleID   string
+	SecretID string
+
+	// kubernetes
+	K8sRole      string
+	K8sTokenPath string
+
+	// aws-iam
+	AWSRole string
+
+	// token
+	Token string
+}
+
+// TLSConfig mirrors the client TLS settings vault_api.Config.ConfigureTLS
+// understands.
+type TLSConfig struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+	Insecure   bool
+}
+
+// Config configures a VaultCollector.
+type Config struct {
+	// Address overrides the Vault address normally taken from VAULT_ADDR.
+	// Leave empty to use the environment default.
+	Address string
+
+	Auth AuthConfig
+	TLS  TLSConfig
+
+	// CollectLeader and CollectRaft toggle the leader and Raft storage
+	// subsystems, so operators can opt out of calls they aren't
+	// authorized to make.
+	CollectLeader bool
+	CollectRaft   bool
+
+	Logger log.Logger
+}
+
+// VaultCollector collects Vault health, seal, leader, and Raft storage
+// status and exports them using the Prometheus metrics package. It
+// implements prometheus.Collector.
+type VaultCollector struct {
+	client        *vault_api.Client
+	authCfg       AuthConfig
+	leaseDuration time.Duration
+	logger        log.Logger
+
+	collectLeader bool
+	collectRaft   bool
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewVaultCollector returns an initialized VaultCollector. If cfg.Auth
+// selects anything other than the "token" method, it logs in to Vault
+// immediately and starts a background goroutine that keeps the resulting
+// token renewed, re-logging in if a renewal ever fails.
+func NewVaultCollector(cfg Config) (*VaultCollector, error) {
+	vc := vault_api.DefaultConfig()
+	if cfg.Address != "" {
+		vc.Address = cfg.Address
+	}
+	if err := vc.ConfigureTLS(&vault_api.TLSConfig{
+		CACert:     cfg.TLS.CACert,
+		ClientCert: cfg.TLS.ClientCert,
+		ClientKey:  cfg.TLS.ClientKey,
+		Insecure:   cfg.TLS.Insecure,
+	}); err != nil {
+		return nil, fmt.Errorf("configuring Vault client TLS: %v", err)
+	}
+
+	client, err := vault_api.NewClient(vc)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	c := &VaultCollector{
+		client:        client,
+		authCfg:       cfg.Auth,
+		collectLeader: cfg.CollectLeader,
+		collectRaft:   cfg.CollectRaft,
+		logger:        logger,
+		stopCh:        make(chan struct{}),
+	}
+
+	if err := c.authenticate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Auth.Method != "token" {
+		go c.renewLoop()
+	}
+
+	return c, nil
+}
+
+// Client returns the authenticated Vault client this collector scrapes
+// with, so callers can reuse it (e.g. to also scrape sys/metrics).
+func (c *VaultCollector) Client() *vault_api.Client {
+	return c.client
+}
+
+// Close stops the background renewal goroutine started for non-"token"
+// auth methods, if one was started. Callers that build a throwaway
+// VaultCollector (e.g. one per /probe request) must call Close once
+// they're done with it, or that goroutine keeps renewing and re-logging
+// in for the rest of the process's life. Close is safe to call more than
+// once and safe to call even when no renewal goroutine was started.
+func (c *VaultCollector) Close() {
+	c.closeOnce.Do(func() { close(c.stopCh) })
+}
+
+// authenticate logs in to Vault with the configured auth method and sets
+// the resulting token on the client.
+func (c *VaultCollector) authenticate() error {
+	token, leaseDuration, err := login(c.client, c.authCfg)
+	if err != nil {
+		return err
+	}
+	c.client.SetToken(token)
+	c.leaseDuration = leaseDuration
+	return nil
+}
+
+// renewLoop keeps the collector's Vault token alive until Close is called,
+// renewing it before its lease expires and re-authenticating from scratch
+// if a renewal is rejected.
+func (c *VaultCollector) renewLoop() {
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-time.After(c.renewInterval()):
+		}
+
+		secret, err := c.client.Auth().Token().RenewSelf(0)
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "failed to renew Vault token, re-authenticating", "err", err)
+			if err := c.authenticate(); err != nil {
+				level.Error(c.logger).Log("msg", "failed to re-authenticate with Vault", "method", c.authCfg.Method, "err", err)
+			}
+			continue
+		}
+
+		if secret != nil && secret.Auth != nil {
+			c.leaseDuration = time.Duration(secret.Auth.LeaseDuration) * time.Second
+		}
+	}
+}
+
+// renewInterval picks how long to sleep before the next renewal attempt,
+// aiming to renew well before the current lease runs out.
+func (c *VaultCollector) renewInterval() time.Duration {
+	interval := c.leaseDuration * 2 / 3
+	if interval < minRenewInterval {
+		return minRenewInterval
+	}
+	return interval
+}
+
+// Describe describes all the metrics ever exported by the Vault collector.
+// It implements prometheus.Collector.
+func (c *VaultCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- up
+	ch <- initialized
+	ch <- sealed
+	ch <- standby
+	ch <- ver
+	ch <- clusterName
+	ch <- clusterID
+	ch <- replicationDRSecondary
+	ch <- sealThreshold
+	ch <- sealProgress
+	ch <- leaderIsSelf
+	ch <- haEnabled
+	ch <- raftPeers
+	ch <- raftPeerHealthy
+	ch <- raftLastIndexGap
+}
+
+func bool2float(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Collect fetches the stats from the configured Vault and delivers them
+// as Prometheus metrics. It implements prometheus.Collector.
+func (c *VaultCollector) Collect(ch chan<- prometheus.Metric) {
+	health, err := c.client.Sys().Health()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, 0,
+		)
+		level.Error(c.logger).Log("msg", "failed to collect health from Vault server", "err", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		up, prometheus.GaugeValue, 1,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		initialized, prometheus.GaugeValue, bool2float(health.Initialized),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		sealed, prometheus.GaugeValue, bool2float(health.Sealed),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		standby, prometheus.GaugeValue, bool2float(health.Standby),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		ver, prometheus.GaugeValue, 1, health.Version,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		clusterName, prometheus.GaugeValue, 1, health.ClusterName,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		clusterID, prometheus.GaugeValue, 1, health.ClusterID,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		replicationDRSecondary, prometheus.GaugeValue, bool2float(health.ReplicationDRMode == "secondary"),
+	)
+
+	c.collectSealStatus(ch)
+
+	if c.collectLeader {
+		c.collectLeaderStatus(ch)
+	}
+
+	if c.collectRaft {
+		c.collectRaftStatus(ch)
+	}
+}
+
+// collectSealStatus polls Sys().SealStatus() and emits the unseal
+// threshold and progress.
+func (c *VaultCollector) collectSealStatus(ch chan<- prometheus.Metric) {
+	status, err := c.client.Sys().SealStatus()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to collect seal status from Vault server", "err", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		sealThreshold, prometheus.GaugeValue, float64(status.T),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		sealProgress, prometheus.GaugeValue, float64(status.Progress),
+	)
+}
+
+// collectLeaderStatus polls Sys().Leader() and emits whether this node is
+// the leader and whether HA is enabled.
+func (c *VaultCollector) collectLeaderStatus(ch chan<- prometheus.Metric) {
+	leader, err := c.client.Sys().Leader()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to collect leader status from Vault server", "err", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		leaderIsSelf, prometheus.GaugeValue, bool2float(leader.IsSelf),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		haEnabled, prometheus.GaugeValue, bool2float(leader.HAEnabled),
+	)
+}
+
+// collectRaftStatus polls Sys().RaftAutopilotState() and emits per-peer
+// health and how far behind the leader's last log index each peer is. It
+// is a no-op against Vaults not backed by integrated storage, since
+// autopilot then reports no servers.
+func (c *VaultCollector) collectRaftStatus(ch chan<- prometheus.Metric) {
+	state, err := c.client.Sys().RaftAutopilotState()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to collect Raft autopilot state from Vault server", "err", err)
+		return
+	}
+	if state == nil || len(state.Servers) == 0 {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		raftPeers, prometheus.GaugeValue, float64(len(state.Servers)),
+	)
+
+	var leaderIndex uint64
+	if leader, ok := state.Servers[state.Leader]; ok {
+		leaderIndex = leader.LastIndex
+	}
+
+	for id, server := range state.Servers {
+		ch <- prometheus.MustNewConstMetric(
+			raftPeerHealthy, prometheus.GaugeValue, bool2float(server.Healthy), id, server.Address,
+		)
+		if leaderIndex > 0 {
+			var gap uint64
+			if server.LastIndex < leaderIndex {
+				gap = leaderIndex - server.LastIndex
+			}
+			ch <- prometheus.MustNewConstMetric(
+				raftLastIndexGap, prometheus.GaugeValue, float64(gap), id, server.Address,
+			)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// vaultResponses holds the canned JSON bodies a fakeVault serves for each
+// endpoint VaultCollector.Collect polls.
+type vaultResponses struct {
+	health string
+	seal   string
+	leader string
+}
+
+// fakeVault starts an httptest.Server standing in for a single Vault node,
+// returning the given canned responses for the endpoints this package
+// knows how to scrape. Raft autopilot state is omitted by most tests since
+// its map-typed Servers field iterates in random order, which would make
+// the expected Prometheus text non-deterministic.
+func fakeVault(t *testing.T, r vaultResponses) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/sys/health", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, r.health)
+	})
+	mux.HandleFunc("/v1/sys/seal-status", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, r.seal)
+	})
+	mux.HandleFunc("/v1/sys/leader", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, r.leader)
+	})
+	mux.HandleFunc("/v1/sys/storage/raft/autopilot/state", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"healthy":true,"servers":{}}`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+const defaultSealStatus = `{"sealed":false,"t":3,"n":5,"progress":0}`
+const defaultLeader = `{"ha_enabled":true,"is_self":true}`
+
+func TestVaultCollector_Collect(t *testing.T) {
+	cases := []struct {
+		name   string
+		health string
+		seal   string
+		leader string
+	}{
+		{
+			name:   "sealed",
+			health: `{"initialized":true,"sealed":true,"standby":false,"version":"1.9.0","cluster_name":"vault-cluster","cluster_id":"cid-1"}`,
+			seal:   `{"sealed":true,"t":3,"n":5,"progress":1}`,
+			leader: defaultLeader,
+		},
+		{
+			name:   "uninitialized",
+			health: `{"initialized":false,"sealed":true,"standby":false,"version":"1.9.0","cluster_name":"vault-cluster","cluster_id":"cid-1"}`,
+			seal:   `{"sealed":true,"t":0,"n":0,"progress":0}`,
+			leader: defaultLeader,
+		},
+		{
+			name:   "standby",
+			health: `{"initialized":true,"sealed":false,"standby":true,"version":"1.9.0","cluster_name":"vault-cluster","cluster_id":"cid-1"}`,
+			seal:   defaultSealStatus,
+			leader: `{"ha_enabled":true,"is_self":false}`,
+		},
+		{
+			name:   "dr-secondary",
+			health: `{"initialized":true,"sealed":false,"standby":true,"replication_dr_mode":"secondary","version":"1.9.0","cluster_name":"vault-cluster","cluster_id":"cid-1"}`,
+			seal:   defaultSealStatus,
+			leader: `{"ha_enabled":true,"is_self":false}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakeVault(t, vaultResponses{health: tc.health, seal: tc.seal, leader: tc.leader})
+			defer srv.Close()
+
+			vc, err := NewVaultCollector(Config{
+				Address:       srv.URL,
+				Auth:          AuthConfig{Method: "token", Token: "root"},
+				CollectLeader: true,
+				CollectRaft:   false,
+				Logger:        log.NewNopLogger(),
+			})
+			if err != nil {
+				t.Fatalf("NewVaultCollector: %v", err)
+			}
+
+			golden, err := os.Open("testdata/" + strings.ReplaceAll(tc.name, "-", "_") + ".txt")
+			if err != nil {
+				t.Fatalf("opening golden file: %v", err)
+			}
+			defer golden.Close()
+
+			if err := testutil.CollectAndCompare(vc, golden); err != nil {
+				t.Errorf("unexpected collection result: %v", err)
+			}
+		})
+	}
+}
+
+// TestVaultCollector_NetworkError verifies a node that can't be reached at
+// all reports vault_up=0, without panicking.
+func TestVaultCollector_NetworkError(t *testing.T) {
+	srv := fakeVault(t, vaultResponses{health: `{}`, seal: defaultSealStatus, leader: defaultLeader})
+	srv.Close() // close immediately so requests to it fail to connect
+
+	vc, err := NewVaultCollector(Config{
+		Address:       srv.URL,
+		Auth:          AuthConfig{Method: "token", Token: "root"},
+		CollectLeader: true,
+		CollectRaft:   true,
+		Logger:        log.NewNopLogger(),
+	})
+	if err != nil {
+		t.Fatalf("NewVaultCollector: %v", err)
+	}
+
+	golden := strings.NewReader(`
+		# HELP vault_up Was the last query of Vault successful.
+		# TYPE vault_up gauge
+		vault_up 0
+	`)
+
+	if err := testutil.CollectAndCompare(vc, golden, "vault_up"); err != nil {
+		t.Errorf("unexpected collection result: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	vault_api "github.com/hashicorp/vault/api"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// telemetryCacheTTL bounds how long a scrape of Vault's own telemetry is
+// reused, so a burst of near-simultaneous requests to our /metrics doesn't
+// turn into a burst of requests to sys/metrics.
+const telemetryCacheTTL = 5 * time.Second
+
+// telemetryMetric is a flattened, already-renamed sample pulled out of one
+// of Vault's native telemetry responses, ready to be handed to Prometheus.
+type telemetryMetric struct {
+	name      string
+	help      string
+	labels    map[string]string
+	value     float64
+	valueType prometheus.ValueType
+}
+
+// TelemetryCollector scrapes Vault's internal sys/metrics endpoint on every
+// Collect and re-exports it under the vault_ namespace. It implements
+// prometheus.Collector the same way VaultCollector does, so it can be registered
+// alongside it.
+type TelemetryCollector struct {
+	client *vault_api.Client
+	format string // "prometheus" or "json"
+	logger log.Logger
+
+	mu       sync.Mutex
+	cached   []telemetryMetric
+	cachedAt time.Time
+}
+
+// NewTelemetryCollector returns a collector that scrapes Vault's own
+// telemetry through client, using the given response format.
+func NewTelemetryCollector(client *vault_api.Client, format string, logger log.Logger) *TelemetryCollector {
+	return &TelemetryCollector{
+		client: client,
+		format: format,
+		logger: logger,
+	}
+}
+
+// Describe intentionally sends nothing: sys/metrics returns a version- and
+// configuration-dependent set of metric families, so this collector is
+// "unchecked" and only validated at Collect time.
+func (c *TelemetryCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *TelemetryCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics, err := c.scrape()
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to collect Vault telemetry", "err", err)
+		return
+	}
+
+	for _, m := range metrics {
+		desc := prometheus.NewDesc(m.name, m.help, nil, m.labels)
+		ch <- prometheus.MustNewConstMetric(desc, m.valueType, m.value)
+	}
+}
+
+// scrape returns the last scrape of sys/metrics, re-fetching it if the
+// cached copy is older than telemetryCacheTTL.
+func (c *TelemetryCollector) scrape() ([]telemetryMetric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.cachedAt) < telemetryCacheTTL {
+		return c.cached, nil
+	}
+
+	var metrics []telemetryMetric
+	var err error
+	if c.format == "json" {
+		metrics, err = c.scrapeJSON()
+	} else {
+		metrics, err = c.scrapePrometheus()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.cached = metrics
+	c.cachedAt = time.Now()
+	return metrics, nil
+}
+
+// scrapePrometheus fetches sys/metrics?format=prometheus and translates
+// each metric family into the exporter's namespace.
+func (c *TelemetryCollector) scrapePrometheus() ([]telemetryMetric, error) {
+	req := c.client.NewRequest("GET", "/v1/sys/metrics")
+	req.Params.Set("format", "prometheus")
+
+	resp, err := c.client.RawRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting sys/metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing sys/metrics response: %v", err)
+	}
+
+	var metrics []telemetryMetric
+	for name, family := range families {
+		rewritten := rewriteMetricName(name)
+		for _, m := range family.GetMetric() {
+			metrics = append(metrics, dtoMetricToTelemetry(rewritten, family.GetHelp(), family.GetType(), m)...)
+		}
+	}
+	return metrics, nil
+}
+
+// goMetricsJSON mirrors the subset of hashicorp/go-metrics' JSON export
+// format that sys/metrics?format=json (or the pre-Prometheus-support Vaults
+// that only ever spoke this format) returns.
+type goMetricsJSON struct {
+	Counters []goMetricSample `json:"Counters"`
+	Gauges   []goMetricGauge  `json:"Gauges"`
+	Samples  []goMetricSample `json:"Samples"`
+}
+
+type goMetricGauge struct {
+	Name   string            `json:"Name"`
+	Value  float64           `json:"Value"`
+	Labels map[string]string `json:"Labels"`
+}
+
+type goMetricSample struct {
+	Name   string            `json:"Name"`
+	Count  int               `json:"Count"`
+	Sum    float64           `json:"Sum"`
+	Mean   float64           `json:"Mean"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// scrapeJSON fetches sys/metrics?format=json and translates it into the
+// same flattened shape scrapePrometheus produces, for Vaults too old to
+// support the Prometheus format.
+func (c *TelemetryCollector) scrapeJSON() ([]telemetryMetric, error) {
+	req := c.client.NewRequest("GET", "/v1/sys/metrics")
+	req.Params.Set("format", "json")
+
+	resp, err := c.client.RawRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting sys/metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading sys/metrics response: %v", err)
+	}
+
+	var payload goMetricsJSON
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("parsing sys/metrics json response: %v", err)
+	}
+
+	var metrics []telemetryMetric
+	for _, g := range payload.Gauges {
+		metrics = append(metrics, telemetryMetric{
+			name:      rewriteMetricName(g.Name),
+			help:      "Vault telemetry gauge, via sys/metrics?format=json.",
+			labels:    g.Labels,
+			value:     g.Value,
+			valueType: prometheus.GaugeValue,
+		})
+	}
+	for _, cnt := range payload.Counters {
+		metrics = append(metrics, telemetryMetric{
+			name:      rewriteMetricName(cnt.Name),
+			help:      "Vault telemetry counter, via sys/metrics?format=json.",
+			labels:    cnt.Labels,
+			value:     cnt.Sum,
+			valueType: prometheus.CounterValue,
+		})
+	}
+	for _, s := range payload.Samples {
+		metrics = append(metrics, telemetryMetric{
+			name:      rewriteMetricName(s.Name) + "_mean",
+			help:      "Mean of a Vault telemetry sample, via sys/metrics?format=json.",
+			labels:    s.Labels,
+			value:     s.Mean,
+			valueType: prometheus.GaugeValue,
+		})
+	}
+	return metrics, nil
+}
+
+// rewriteMetricName rewrites a metric family name so it fits the exporter's
+// vault_ namespace convention, without double-prefixing names Vault already
+// emits as vault_*.
+func rewriteMetricName(name string) string {
+	name = strings.NewReplacer(".", "_", "-", "_").Replace(name)
+	if strings.HasPrefix(name, namespace+"_") {
+		return name
+	}
+	return namespace + "_" + name
+}
+
+// dtoMetricToTelemetry flattens a single parsed Prometheus metric (as
+// produced by expfmt) into one or more telemetryMetrics. Summaries expand
+// into their sum, count, and per-quantile samples; hashicorp/go-metrics
+// never emits histograms, so that type isn't handled here.
+func dtoMetricToTelemetry(name, help string, mtype dto.MetricType, m *dto.Metric) []telemetryMetric {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+
+	switch mtype {
+	case dto.MetricType_COUNTER:
+		return []telemetryMetric{{name: name, help: help, labels: labels, value: m.GetCounter().GetValue(), valueType: prometheus.CounterValue}}
+
+	case dto.MetricType_GAUGE:
+		return []telemetryMetric{{name: name, help: help, labels: labels, value: m.GetGauge().GetValue(), valueType: prometheus.GaugeValue}}
+
+	case dto.MetricType_SUMMARY:
+		summary := m.GetSummary()
+		metrics := []telemetryMetric{
+			{name: name + "_sum", help: help, labels: labels, value: summary.GetSampleSum(), valueType: prometheus.GaugeValue},
+			{name: name + "_count", help: help, labels: labels, value: float64(summary.GetSampleCount()), valueType: prometheus.GaugeValue},
+		}
+		for _, q := range summary.GetQuantile() {
+			qLabels := make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				qLabels[k] = v
+			}
+			qLabels["quantile"] = strconv.FormatFloat(q.GetQuantile(), 'g', -1, 64)
+			metrics = append(metrics, telemetryMetric{name: name, help: help, labels: qLabels, value: q.GetValue(), valueType: prometheus.GaugeValue})
+		}
+		return metrics
+
+	default:
+		return []telemetryMetric{{name: name, help: help, labels: labels, value: m.GetUntyped().GetValue(), valueType: prometheus.UntypedValue}}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/etsangsplk/vault_exporter/pkg/collector"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeHandler backs /probe: for each request it builds a throwaway
+// VaultCollector for the requested target and module, runs exactly one
+// collection into a fresh registry, and renders that registry the same
+// way promhttp.Handler renders the process-wide one. This mirrors the
+// multi-target pattern used by blackbox_exporter and snmp_exporter, so a
+// single vault_exporter process can cover an entire cluster. The
+// collector is closed once the request is served, so its renewal
+// goroutine (started for non-"token" modules) doesn't outlive the probe.
+type probeHandler struct {
+	config        *safeConfig
+	collectLeader bool
+	collectRaft   bool
+	metricsFormat string
+	logger        log.Logger
+}
+
+func newProbeHandler(config *safeConfig, collectLeader, collectRaft bool, metricsFormat string, logger log.Logger) *probeHandler {
+	return &probeHandler{
+		config:        config,
+		collectLeader: collectLeader,
+		collectRaft:   collectRaft,
+		metricsFormat: metricsFormat,
+		logger:        logger,
+	}
+}
+
+func (p *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	if _, err := url.Parse(target); err != nil {
+		http.Error(w, fmt.Sprintf("invalid target %q: %v", target, err), http.StatusBadRequest)
+		return
+	}
+
+	moduleName := params.Get("module")
+	if moduleName == "" {
+		moduleName = "default"
+	}
+	module, ok := p.config.get().Modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	vc, err := collector.NewVaultCollector(collector.Config{
+		Address:       target,
+		Auth:          module.Auth.authConfig(),
+		TLS:           module.TLS.tlsConfig(),
+		CollectLeader: p.collectLeader,
+		CollectRaft:   p.collectRaft,
+		Logger:        p.logger,
+	})
+	if err != nil {
+		level.Error(p.logger).Log("msg", "failed to build VaultCollector for probe", "target", target, "module", moduleName, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer vc.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(vc)
+	registry.MustRegister(collector.NewTelemetryCollector(vc.Client(), p.metricsFormat, p.logger))
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}